@@ -0,0 +1,306 @@
+// Package config provides the typed configuration for the faas-nomad
+// provider. Settings are assembled in layers, lowest priority first:
+// built-in defaults, an optional config file, CLI flags, then
+// deprecated environment variables. The defaults and the file are each
+// a *Config; the flags, with any deprecated environment variables
+// written over them, form a third *Config. Each is merged onto the one
+// before it with Merge.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/hcl"
+)
+
+// MetricsConfig describes the sinks the provider should emit metrics to.
+type MetricsConfig struct {
+	StatsDAddr        string `hcl:"statsd_addr"`
+	DogStatsDAddr     string `hcl:"dogstatsd_addr"`
+	PrometheusEnabled bool   `hcl:"prometheus_enabled"`
+	PrometheusBind    string `hcl:"prometheus_bind"`
+	CirconusAPIToken  string `hcl:"circonus_api_token"`
+	CirconusAPIApp    string `hcl:"circonus_api_app"`
+}
+
+// TracingConfig describes the OTLP exporter used for distributed tracing.
+type TracingConfig struct {
+	Enabled     bool    `hcl:"enabled"`
+	Endpoint    string  `hcl:"endpoint"`
+	SampleRatio float64 `hcl:"sample_ratio"`
+}
+
+// Config is the fully resolved set of options for the provider. Fields
+// are pointers so that a layer which does not set a value can be merged
+// onto a lower priority layer without clobbering it with a zero value.
+type Config struct {
+	Port                  *int            `hcl:"port"`
+	NodeAddr              *string         `hcl:"node_addr"`
+	NomadAddr             *string         `hcl:"nomad_addr"`
+	NomadRegion           *string         `hcl:"nomad_region"`
+	ConsulAddr            *string         `hcl:"consul_addr"`
+	ConsulACL             *string         `hcl:"consul_acl"`
+	EnableConsulDNS       *bool           `hcl:"enable_consul_dns"`
+	EnableBasicAuth       *bool           `hcl:"enable_basic_auth"`
+	BasicAuthSecretPath   *string         `hcl:"basic_auth_secret_path"`
+	VaultDefaultPolicy    *string         `hcl:"vault_default_policy"`
+	VaultSecretPathPrefix *string         `hcl:"vault_secret_path_prefix"`
+	FunctionTimeout       *string         `hcl:"function_timeout"`
+	LoggerFormat          *string         `hcl:"logger_format"`
+	LoggerLevel           *string         `hcl:"logger_level"`
+	LoggerOutput          *string         `hcl:"logger_output"`
+	LoggerMaxSize         *int            `hcl:"logger_max_size"`
+	LoggerMaxBackups      *int            `hcl:"logger_max_backups"`
+	LoggerMaxAge          *int            `hcl:"logger_max_age"`
+	LoggerCompress        *bool           `hcl:"logger_compress"`
+	Metrics               *MetricsConfig  `hcl:"metrics"`
+	Tracing               *TracingConfig  `hcl:"tracing"`
+}
+
+// ReadConfig assembles the final configuration by merging, in order of
+// increasing priority: built-in defaults, an optional config file, and
+// the values already set on flags. Callers pass the flag-derived layer
+// so CLI arguments always win over the file.
+func ReadConfig(configPath string, fromFlags *Config) (*Config, error) {
+	cfg := Default()
+
+	if configPath != "" {
+		fileCfg, err := LoadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg = cfg.Merge(fileCfg)
+	}
+
+	return cfg.Merge(fromFlags), nil
+}
+
+// Default returns the baseline configuration used before any config
+// file, flag, or environment variable is applied.
+func Default() *Config {
+	return &Config{
+		Port:                  intPtr(8080),
+		NodeAddr:              strPtr("localhost"),
+		NomadAddr:             strPtr("localhost:4646"),
+		NomadRegion:           strPtr("global"),
+		ConsulAddr:            strPtr("http://localhost:8500"),
+		ConsulACL:             strPtr(""),
+		EnableConsulDNS:       boolPtr(false),
+		EnableBasicAuth:       boolPtr(false),
+		BasicAuthSecretPath:   strPtr("/secrets"),
+		VaultDefaultPolicy:    strPtr("openfaas"),
+		VaultSecretPathPrefix: strPtr("secret/openfaas"),
+		FunctionTimeout:       strPtr("30s"),
+		LoggerFormat:          strPtr("text"),
+		LoggerLevel:           strPtr("INFO"),
+		LoggerOutput:          strPtr(""),
+		LoggerMaxSize:         intPtr(100),
+		LoggerMaxBackups:      intPtr(5),
+		LoggerMaxAge:          intPtr(28),
+		LoggerCompress:        boolPtr(false),
+		Metrics: &MetricsConfig{
+			StatsDAddr:     "localhost:8125",
+			PrometheusBind: ":8081",
+		},
+		Tracing: &TracingConfig{
+			SampleRatio: 1.0,
+		},
+	}
+}
+
+// LoadFile parses an HCL or JSON config file into a *Config. Both
+// formats are handled by the same hcl.Parse call.
+func LoadFile(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %s", path, err)
+	}
+
+	c := &Config{}
+	if err := hcl.Unmarshal(raw, c); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %s", path, err)
+	}
+
+	return c, nil
+}
+
+// Merge layers other on top of c, returning a new *Config. Any field
+// set on other takes precedence; unset fields fall through to c.
+func (c *Config) Merge(other *Config) *Config {
+	if other == nil {
+		return c
+	}
+
+	out := *c
+
+	if other.Port != nil {
+		out.Port = other.Port
+	}
+	if other.NodeAddr != nil {
+		out.NodeAddr = other.NodeAddr
+	}
+	if other.NomadAddr != nil {
+		out.NomadAddr = other.NomadAddr
+	}
+	if other.NomadRegion != nil {
+		out.NomadRegion = other.NomadRegion
+	}
+	if other.ConsulAddr != nil {
+		out.ConsulAddr = other.ConsulAddr
+	}
+	if other.ConsulACL != nil {
+		out.ConsulACL = other.ConsulACL
+	}
+	if other.EnableConsulDNS != nil {
+		out.EnableConsulDNS = other.EnableConsulDNS
+	}
+	if other.EnableBasicAuth != nil {
+		out.EnableBasicAuth = other.EnableBasicAuth
+	}
+	if other.BasicAuthSecretPath != nil {
+		out.BasicAuthSecretPath = other.BasicAuthSecretPath
+	}
+	if other.VaultDefaultPolicy != nil {
+		out.VaultDefaultPolicy = other.VaultDefaultPolicy
+	}
+	if other.VaultSecretPathPrefix != nil {
+		out.VaultSecretPathPrefix = other.VaultSecretPathPrefix
+	}
+	if other.FunctionTimeout != nil {
+		out.FunctionTimeout = other.FunctionTimeout
+	}
+	if other.LoggerFormat != nil {
+		out.LoggerFormat = other.LoggerFormat
+	}
+	if other.LoggerLevel != nil {
+		out.LoggerLevel = other.LoggerLevel
+	}
+	if other.LoggerOutput != nil {
+		out.LoggerOutput = other.LoggerOutput
+	}
+	if other.LoggerMaxSize != nil {
+		out.LoggerMaxSize = other.LoggerMaxSize
+	}
+	if other.LoggerMaxBackups != nil {
+		out.LoggerMaxBackups = other.LoggerMaxBackups
+	}
+	if other.LoggerMaxAge != nil {
+		out.LoggerMaxAge = other.LoggerMaxAge
+	}
+	if other.LoggerCompress != nil {
+		out.LoggerCompress = other.LoggerCompress
+	}
+	if other.Metrics != nil {
+		out.Metrics = mergeMetrics(out.Metrics, other.Metrics)
+	}
+	if other.Tracing != nil {
+		out.Tracing = mergeTracing(out.Tracing, other.Tracing)
+	}
+
+	return &out
+}
+
+// mergeMetrics layers other onto base field-by-field, the same way the
+// top-level *Config pointers are merged, so that e.g. a -statsd_addr
+// flag doesn't wipe out a dogstatsd_addr or circonus_api_token that was
+// only set in the config file.
+func mergeMetrics(base, other *MetricsConfig) *MetricsConfig {
+	if base == nil {
+		base = &MetricsConfig{}
+	}
+	out := *base
+
+	if other.StatsDAddr != "" {
+		out.StatsDAddr = other.StatsDAddr
+	}
+	if other.DogStatsDAddr != "" {
+		out.DogStatsDAddr = other.DogStatsDAddr
+	}
+	if other.PrometheusEnabled {
+		out.PrometheusEnabled = other.PrometheusEnabled
+	}
+	if other.PrometheusBind != "" {
+		out.PrometheusBind = other.PrometheusBind
+	}
+	if other.CirconusAPIToken != "" {
+		out.CirconusAPIToken = other.CirconusAPIToken
+	}
+	if other.CirconusAPIApp != "" {
+		out.CirconusAPIApp = other.CirconusAPIApp
+	}
+
+	return &out
+}
+
+// mergeTracing layers other onto base field-by-field; see mergeMetrics.
+func mergeTracing(base, other *TracingConfig) *TracingConfig {
+	if base == nil {
+		base = &TracingConfig{}
+	}
+	out := *base
+
+	if other.Enabled {
+		out.Enabled = other.Enabled
+	}
+	if other.Endpoint != "" {
+		out.Endpoint = other.Endpoint
+	}
+	if other.SampleRatio != 0 {
+		out.SampleRatio = other.SampleRatio
+	}
+
+	return &out
+}
+
+// FunctionTimeoutDuration parses FunctionTimeout, falling back to 30s if
+// it is unset or malformed.
+func (c *Config) FunctionTimeoutDuration() time.Duration {
+	if c.FunctionTimeout == nil {
+		return 30 * time.Second
+	}
+
+	d, err := time.ParseDuration(*c.FunctionTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+
+	return d
+}
+
+func intPtr(i int) *int       { return &i }
+func strPtr(s string) *string { return &s }
+func boolPtr(b bool) *bool    { return &b }
+
+// Live wraps a *Config in an atomic.Value so a background reload (e.g.
+// triggered by SIGHUP) can swap the active configuration without the
+// handlers reading it needing any locking of their own.
+type Live struct {
+	v atomic.Value
+}
+
+// NewLive creates a Live accessor seeded with the given config.
+func NewLive(c *Config) *Live {
+	l := &Live{}
+	l.v.Store(c)
+	return l
+}
+
+// Get returns the currently active configuration.
+func (l *Live) Get() *Config {
+	return l.v.Load().(*Config)
+}
+
+// FunctionTimeoutDuration returns the current function timeout,
+// re-read from whatever config is active at call time so a SIGHUP
+// reload takes effect on the very next request.
+func (l *Live) FunctionTimeoutDuration() time.Duration {
+	return l.Get().FunctionTimeoutDuration()
+}
+
+// Set atomically replaces the active configuration.
+func (l *Live) Set(c *Config) {
+	l.v.Store(c)
+}
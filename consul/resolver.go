@@ -0,0 +1,94 @@
+// Package consul resolves a deployed function's name to a live address
+// by querying Consul's health API for the service faas-nomad registers
+// each function under.
+package consul
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/tracing"
+)
+
+// ServiceResolver resolves a function name to the address of one of its
+// healthy instances.
+type ServiceResolver interface {
+	Resolve(ctx context.Context, name string) (string, error)
+}
+
+// Resolver is the Consul-backed ServiceResolver used by the function
+// proxy and the delete handler.
+type Resolver struct {
+	client   *consulapi.Client
+	logger   logging.Service
+	aclToken atomic.Value
+}
+
+// NewResolver builds a Resolver talking to the Consul agent at addr.
+func NewResolver(addr, aclToken string, logger logging.Service) *Resolver {
+	cfg := consulapi.DefaultConfig()
+	cfg.Address = addr
+	cfg.Token = aclToken
+
+	client, err := consulapi.NewClient(cfg)
+	if err != nil {
+		logger.Error("Unable to create consul client", "error", err)
+	}
+
+	r := &Resolver{client: client, logger: logger}
+	r.aclToken.Store(aclToken)
+	return r
+}
+
+// SetACLToken atomically replaces the ACL token used for subsequent
+// Consul API calls, so a SIGHUP config reload can rotate it without a
+// restart.
+func (r *Resolver) SetACLToken(token string) {
+	r.aclToken.Store(token)
+}
+
+// Resolve returns the address of one healthy instance of the named
+// function, blocking with a short backoff while none are healthy (a
+// function scaled to zero is still warming up). A "cold_start" span
+// event is recorded the first time Resolve finds zero healthy
+// instances, so a slow scale-up is visible in the trace without
+// needing debug logs. Once an instance is found, resolver.endpoint and
+// function.replicas are attached to the caller's span (typically
+// "faas.invoke").
+func (r *Resolver) Resolve(ctx context.Context, name string) (string, error) {
+	callerCtx := ctx
+	ctx, span := tracing.Tracer("consul.resolver").Start(ctx, "consul.resolve")
+	defer span.End()
+
+	notedColdStart := false
+
+	for {
+		services, _, err := r.client.Health().Service(name, "", true, &consulapi.QueryOptions{Token: r.aclToken.Load().(string)})
+		if err != nil {
+			return "", fmt.Errorf("unable to query consul for service %s: %s", name, err)
+		}
+
+		if len(services) > 0 {
+			svc := services[0].Service
+			endpoint := fmt.Sprintf("%s:%d", svc.Address, svc.Port)
+			tracing.NoteResolved(callerCtx, endpoint, len(services))
+			return endpoint, nil
+		}
+
+		if !notedColdStart {
+			tracing.NoteColdStart(ctx, name)
+			notedColdStart = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
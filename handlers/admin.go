@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"github.com/hashicorp/faas-nomad/logging"
+)
+
+// loggerLevelRequest is the body accepted by the admin logger endpoint.
+type loggerLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// MakeAdminLoggerHandler returns a handler for PUT /system/logger that
+// changes the running log level without a restart. It is expected to be
+// mounted behind the same basic-auth middleware as the rest of the
+// provider's admin surface.
+func MakeAdminLoggerHandler(logger logging.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body loggerLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Level == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		logger.SetLevel(body.Level)
+		logger.Info("Log level changed via admin endpoint", "level", body.Level)
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// BasicAuth wraps next with the same secret-mounted basic auth scheme
+// OpenFaaS uses for the gateway (files named "basic-auth-user" and
+// "basic-auth-password" under secretPath), so the admin surface doesn't
+// need a second credential store. getSecretPath is called once per
+// request so a SIGHUP-driven config reload of basic_auth_secret_path
+// takes effect immediately.
+func BasicAuth(getSecretPath func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !validCredentials(getSecretPath(), user, pass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="faas-nomadd admin"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validCredentials(secretPath, user, pass string) bool {
+	wantUser, err := ioutil.ReadFile(filepath.Join(secretPath, "basic-auth-user"))
+	if err != nil {
+		return false
+	}
+	wantPass, err := ioutil.ReadFile(filepath.Join(secretPath, "basic-auth-password"))
+	if err != nil {
+		return false
+	}
+
+	return string(wantUser) == user && string(wantPass) == pass
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hashicorp/faas-nomad/consul"
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/metrics"
+	"github.com/hashicorp/faas-nomad/nomad"
+	"github.com/hashicorp/faas-nomad/tracing"
+	"github.com/hashicorp/nomad/api"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// MakeDelete returns a handler for DELETE /system/functions that
+// deregisters the named function's Nomad job. resolver is accepted so
+// the handler can be extended to wait for the Consul service to drain
+// before the job is purged, matching MakeDeploy's shape even though
+// today it only calls Nomad.
+func MakeDelete(resolver *consul.Resolver, jobs nomad.Job, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.DeleteFunctionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Unable to decode delete request", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, span := tracing.Tracer("handlers.delete").Start(r.Context(), "nomad.jobs.deregister")
+		_, _, err := jobs.Deregister(req.FunctionName, true, &api.WriteOptions{})
+		span.End()
+
+		if err != nil {
+			logger.Error("Unable to deregister function job", "function_name", req.FunctionName, "error", err)
+			stats.Incr("delete.error", []string{"function_name:" + req.FunctionName}, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("Deregistered function job", "function_name", req.FunctionName)
+		stats.Incr("delete.success", []string{"function_name:" + req.FunctionName}, 1)
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/metrics"
+	"github.com/hashicorp/faas-nomad/nomad"
+	"github.com/hashicorp/faas-nomad/tracing"
+	fntypes "github.com/hashicorp/faas-nomad/types"
+	"github.com/hashicorp/nomad/api"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// MakeDeploy returns a handler for POST/PUT /system/functions that
+// registers the requested function as a Nomad job in cfg.Datacenter.
+// The Vault and Consul settings in cfg are not applied to the job.
+func MakeDeploy(jobs nomad.Job, cfg fntypes.ProviderConfig, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.FunctionDeployment
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Unable to decode deploy request", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		job := buildJob(req, cfg)
+
+		_, span := tracing.Tracer("handlers.deploy").Start(r.Context(), "nomad.jobs.register")
+		_, _, err := jobs.Register(job, &api.WriteOptions{})
+		span.End()
+
+		if err != nil {
+			logger.Error("Unable to register function job", "function_name", req.Service, "error", err)
+			stats.Incr("deploy.error", []string{"function_name:" + req.Service}, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("Registered function job", "function_name", req.Service)
+		stats.Incr("deploy.success", []string{"function_name:" + req.Service}, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// buildJob translates an OpenFaaS FunctionDeployment into the Nomad job
+// spec that runs it: a single task group with one docker task, tagged
+// for Consul service discovery under the function's name.
+func buildJob(req types.FunctionDeployment, cfg fntypes.ProviderConfig) *api.Job {
+	count := 1
+	job := api.NewServiceJob(req.Service, req.Service, cfg.Datacenter, 50)
+	job.Datacenters = []string{cfg.Datacenter}
+
+	group := api.NewTaskGroup(req.Service, count)
+	task := api.NewTask(req.Service, "docker")
+	task.Config = map[string]interface{}{
+		"image": req.Image,
+	}
+	task.Services = []*api.Service{
+		{
+			Name: req.Service,
+			Tags: []string{"faas"},
+		},
+	}
+
+	group.Tasks = append(group.Tasks, task)
+	job.TaskGroups = append(job.TaskGroups, group)
+
+	return job
+}
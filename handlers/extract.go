@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+)
+
+// functionNameKey is the context key MakeExtractFunctionMiddleWare uses
+// to pass the resolved function name down to the handlers it wraps.
+type functionNameKey struct{}
+
+// MakeExtractFunctionMiddleWare adapts a router-specific vars lookup
+// (e.g. mux.Vars) into a "name" value carried on the request context,
+// so the proxy and replication handlers don't need to know which
+// router put it there. The request is rebuilt with context.WithValue
+// on top of r.Context(), so anything a wrapper further out already
+// attached (e.g. the span TraceFunctionInvoke starts) is preserved.
+func MakeExtractFunctionMiddleWare(varsFunc func(*http.Request) map[string]string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := varsFunc(r)["name"]
+		ctx := context.WithValue(r.Context(), functionNameKey{}, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// functionNameFromContext returns the function name extracted by
+// MakeExtractFunctionMiddleWare, or "" if none was set.
+func functionNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(functionNameKey{}).(string)
+	return name
+}
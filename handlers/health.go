@@ -0,0 +1,13 @@
+package handlers
+
+import "net/http"
+
+// MakeHealthHandler returns the handler bootstrap.Serve uses for its
+// liveness/readiness probe. It deliberately isn't wrapped by guard:
+// a health check must never be subject to the panic-recovery/timeout
+// middleware that protects the Nomad/Consul-backed handlers.
+func MakeHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
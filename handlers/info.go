@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/metrics"
+)
+
+// providerInfo is the body returned by GET /system/info.
+type providerInfo struct {
+	Provider      string `json:"provider"`
+	Orchestration string `json:"orchestration"`
+	Version       string `json:"version"`
+}
+
+// MakeInfo returns a handler for GET /system/info that reports the
+// provider name and running version to the OpenFaaS gateway/CLI.
+func MakeInfo(logger logging.Service, stats metrics.StatsD, version string) http.HandlerFunc {
+	info := providerInfo{
+		Provider:      "faas-nomadd",
+		Orchestration: "nomad",
+		Version:       version,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/faas-nomad/consul"
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/metrics"
+	"github.com/hashicorp/faas-nomad/tracing"
+)
+
+// ProxyConfig groups the dependencies MakeProxy needs to forward an
+// invocation to a running function instance.
+type ProxyConfig struct {
+	Client   *http.Client
+	Resolver consul.ServiceResolver
+	Logger   logging.Service
+	StatsD   metrics.StatsD
+	Timeout  time.Duration
+}
+
+// MakeProxy returns a handler that resolves the function named by the
+// request (set by MakeExtractFunctionMiddleWare) to a live address via
+// cfg.Resolver, then forwards the request body to it. The resolve and
+// the outbound call both run under the request's context, so they show
+// up as child spans of whatever span TraceFunctionInvoke started.
+func MakeProxy(cfg ProxyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		name := functionNameFromContext(ctx)
+		if name == "" {
+			http.Error(w, "function name not specified", http.StatusBadRequest)
+			return
+		}
+
+		addr, err := cfg.Resolver.Resolve(ctx, name)
+		if err != nil {
+			cfg.Logger.Error("Unable to resolve function", "function_name", name, "error", err)
+			cfg.StatsD.Incr("proxy.resolve_error", []string{"function_name:" + name}, 1)
+			http.Error(w, fmt.Sprintf("unable to resolve function %s", name), http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, span := tracing.Tracer("handlers.proxy").Start(ctx, "faas.proxy_call")
+		defer span.End()
+
+		proxyURL := *r.URL
+		proxyURL.Scheme = "http"
+		proxyURL.Host = addr
+
+		req, err := http.NewRequestWithContext(ctx, r.Method, proxyURL.String(), r.Body)
+		if err != nil {
+			cfg.Logger.Error("Unable to create proxy request", "function_name", name, "error", err)
+			http.Error(w, "unable to create proxy request", http.StatusInternalServerError)
+			return
+		}
+		req.Header = r.Header.Clone()
+
+		start := time.Now()
+		resp, err := cfg.Client.Do(req)
+		if err != nil {
+			cfg.Logger.Error("Unable to call function", "function_name", name, "addr", addr, "error", err)
+			cfg.StatsD.Incr("proxy.call_error", []string{"function_name:" + name}, 1)
+			http.Error(w, fmt.Sprintf("unable to call function %s", name), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+
+		cfg.StatsD.Timing("proxy.call", time.Since(start), []string{"function_name:" + name}, 1)
+	}
+}
+
+// MakeProxyClient builds the http.Client used to call function
+// instances, bounding every call to timeout so a hung function cannot
+// pin the proxying goroutine forever.
+func MakeProxyClient(timeout time.Duration, logger logging.Service) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+	}
+}
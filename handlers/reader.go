@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/metrics"
+	"github.com/hashicorp/faas-nomad/nomad"
+	"github.com/hashicorp/faas-nomad/tracing"
+	"github.com/hashicorp/nomad/api"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// MakeReader returns a handler for GET /system/functions that lists
+// every deployed function by listing Nomad jobs, skipping any whose
+// name starts with "_". Other jobs not deployed by this provider are
+// not filtered out.
+func MakeReader(jobs nomad.Job, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Tracer("handlers.reader").Start(r.Context(), "nomad.jobs.list")
+		list, _, err := jobs.List(&api.QueryOptions{})
+		span.End()
+
+		if err != nil {
+			logger.Error("Unable to list function jobs", "error", err)
+			stats.Incr("reader.error", nil, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		functions := make([]types.FunctionStatus, 0, len(list))
+		for _, j := range list {
+			if strings.HasPrefix(j.Name, "_") {
+				continue
+			}
+			functions = append(functions, types.FunctionStatus{
+				Name: j.Name,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(functions)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/hashicorp/faas-nomad/metrics"
+	hclog "github.com/hashicorp/go-hclog"
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// RequestIDHeader is set on every response, including ones recovered from
+// a panic, so operators can correlate a failed request with the stack
+// trace logged server side.
+const RequestIDHeader = "X-Request-Id"
+
+// Recover wraps next with a panic barrier: a panic anywhere in the
+// handler chain is caught, logged with its stack trace, counted as a
+// "faas.nomadd.panic" metric tagged with the handler name, and turned
+// into a 500 response instead of crashing the provider. It mirrors the
+// recovery interceptor pattern used by grpc-ecosystem's recovery
+// middleware.
+func Recover(handlerName string, logger hclog.Logger, stats metrics.StatsD, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID, err := uuid.GenerateUUID()
+		if err != nil {
+			requestID = "unknown"
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger.Error(
+					"Recovered from panic in handler",
+					"handler", handlerName,
+					"request_id", requestID,
+					"error", fmt.Sprintf("%v", rec),
+					"stack", string(debug.Stack()),
+				)
+
+				stats.Incr("panic", []string{"handler:" + handlerName}, 1)
+
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hashicorp/faas-nomad/logging"
+	"github.com/hashicorp/faas-nomad/metrics"
+	"github.com/hashicorp/faas-nomad/nomad"
+	"github.com/hashicorp/faas-nomad/tracing"
+	"github.com/hashicorp/nomad/api"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// MakeReplicationReader returns a handler for GET
+// /system/scale-function/{name} that reports a function's replica
+// count, read from the count of the Nomad job's first task group. The
+// same value is reported as both the requested and the available
+// replicas; running allocations are not counted.
+func MakeReplicationReader(jobs nomad.Job, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := functionNameFromContext(r.Context())
+
+		_, span := tracing.Tracer("handlers.replication").Start(r.Context(), "nomad.jobs.info")
+		job, _, err := jobs.Info(name, &api.QueryOptions{})
+		span.End()
+
+		if err != nil {
+			logger.Error("Unable to read function job", "function_name", name, "error", err)
+			stats.Incr("replica_reader.error", []string{"function_name:" + name}, 1)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		replicas := uint64(0)
+		if len(job.TaskGroups) > 0 && job.TaskGroups[0].Count != nil {
+			replicas = uint64(*job.TaskGroups[0].Count)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.FunctionStatus{
+			Name:              name,
+			Replicas:          replicas,
+			AvailableReplicas: replicas,
+		})
+	}
+}
+
+// MakeReplicationWriter returns a handler for POST
+// /system/scale-function/{name} that updates a function's replica
+// count by changing the Nomad task group's count and re-registering
+// the job.
+func MakeReplicationWriter(jobs nomad.Job, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := functionNameFromContext(r.Context())
+
+		var req types.ScaleServiceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Unable to decode scale request", "function_name", name, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, span := tracing.Tracer("handlers.replication").Start(r.Context(), "nomad.jobs.info")
+		job, _, err := jobs.Info(name, &api.QueryOptions{})
+		span.End()
+
+		if err != nil {
+			logger.Error("Unable to read function job", "function_name", name, "error", err)
+			stats.Incr("replica_updater.error", []string{"function_name:" + name}, 1)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if len(job.TaskGroups) > 0 {
+			count := int(req.Replicas)
+			job.TaskGroups[0].Count = &count
+		}
+
+		_, span = tracing.Tracer("handlers.replication").Start(ctx, "nomad.jobs.register")
+		_, _, err = jobs.Register(job, &api.WriteOptions{})
+		span.End()
+
+		if err != nil {
+			logger.Error("Unable to update function job", "function_name", name, "error", err)
+			stats.Incr("replica_updater.error", []string{"function_name:" + name}, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		stats.Incr("replica_updater.success", []string{"function_name:" + name}, 1)
+		w.WriteHeader(http.StatusOK)
+	}
+}
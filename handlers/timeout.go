@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout enforces d at the HTTP layer using http.TimeoutHandler, so a
+// Nomad or Consul call that hangs inside next cannot pin the serving
+// goroutine forever. Callers that exceed d receive a 503 with msg as
+// the body; next is still left running in the background until it
+// returns, matching the documented behaviour of http.TimeoutHandler.
+func Timeout(d time.Duration, msg string, next http.Handler) http.Handler {
+	return http.TimeoutHandler(next, d, msg)
+}
+
+// DynamicTimeout is Timeout for a duration that can change at runtime
+// (e.g. backed by a *config.Live reloaded on SIGHUP): getTimeout is
+// called once per request so a reload is picked up by the very next
+// request rather than requiring a restart.
+func DynamicTimeout(getTimeout func() time.Duration, msg string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.TimeoutHandler(next, getTimeout(), msg).ServeHTTP(w, r)
+	})
+}
+
+// ContextDeadline bounds next's request context with getTimeout's
+// duration instead of wrapping the ResponseWriter the way
+// http.TimeoutHandler does. Use this in front of handlers that stream
+// or flush their response (the function proxy): TimeoutHandler buffers
+// the entire body to decide whether the handler or the timeout won the
+// race, which breaks streaming and blocks http.Flusher. next is still
+// expected to honour r.Context()'s deadline itself, e.g. via an
+// http.Client.Timeout or a Consul/Nomad call that takes a context.
+func ContextDeadline(getTimeout func() time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), getTimeout())
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
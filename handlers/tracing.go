@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/faas-nomad/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceFunctionInvoke wraps the function proxy with a "faas.invoke" span
+// covering the whole request: it extracts any W3C traceparent the
+// caller sent and attaches a function.name attribute. Everything
+// downstream (the Consul resolve and the proxied HTTP round trip) runs
+// as a child of this span because next is invoked with the span's
+// context attached to the request. The Nomad calls in MakeDeploy and
+// MakeDelete are served by other handlers and are not under this span.
+func TraceFunctionInvoke(nameFromRequest func(*http.Request) string, next http.Handler) http.Handler {
+	tracer := tracing.Tracer("handlers.proxy")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagationCarrier{r})
+
+		ctx, span := tracer.Start(ctx, "faas.invoke", trace.WithAttributes(
+			attribute.String("function.name", nameFromRequest(r)),
+		))
+		defer span.End()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type propagationCarrier struct {
+	r *http.Request
+}
+
+func (c propagationCarrier) Get(key string) string { return c.r.Header.Get(key) }
+func (c propagationCarrier) Set(key, value string)  { c.r.Header.Set(key, value) }
+func (c propagationCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.r.Header))
+	for k := range c.r.Header {
+		keys = append(keys, k)
+	}
+	return keys
+}
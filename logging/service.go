@@ -0,0 +1,127 @@
+// Package logging provides the Service interface every handler
+// constructor logs through. Today it wraps hclog with a lumberjack file
+// writer so rotated log files are reopened automatically, but the
+// interface is narrow enough that swapping the backend (zap, zerolog)
+// later will not require touching call sites.
+package logging
+
+import (
+	"os"
+
+	"github.com/hashicorp/faas-nomad/config"
+	hclog "github.com/hashicorp/go-hclog"
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Service is the logging interface threaded through every handler
+// constructor in place of a raw hclog.Logger.
+type Service interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+	Fatal(msg string, args ...interface{})
+	With(args ...interface{}) Service
+	Named(name string) Service
+
+	// SetLevel changes the active log level at runtime, used by both
+	// the SIGHUP config reload and the /system/logger admin endpoint.
+	SetLevel(level string)
+
+	// Reopen closes and reopens the underlying log file, used by the
+	// SIGUSR1 handler to recover from an external logrotate-style
+	// rename. It is a no-op when logging to stdout.
+	Reopen() error
+
+	// Hclog exposes the wrapped hclog.Logger for the few call sites
+	// (third-party client constructors) that require one directly.
+	Hclog() hclog.Logger
+}
+
+type service struct {
+	logger hclog.Logger
+	file   *lumberjack.Logger
+}
+
+// New builds a Service from cfg, rotating *cfg.LoggerOutput via
+// lumberjack when a file path is configured, or writing to stdout
+// otherwise.
+func New(cfg *config.Config) (Service, error) {
+	var file *lumberjack.Logger
+
+	if cfg.LoggerOutput != nil && *cfg.LoggerOutput != "" {
+		file = &lumberjack.Logger{
+			Filename:   *cfg.LoggerOutput,
+			MaxSize:    intOrDefault(cfg.LoggerMaxSize, 100),
+			MaxBackups: intOrDefault(cfg.LoggerMaxBackups, 5),
+			MaxAge:     intOrDefault(cfg.LoggerMaxAge, 28),
+			Compress:   boolOrDefault(cfg.LoggerCompress, false),
+		}
+	}
+
+	logJSON := cfg.LoggerFormat != nil && *cfg.LoggerFormat == "json"
+	level := "INFO"
+	if cfg.LoggerLevel != nil {
+		level = *cfg.LoggerLevel
+	}
+
+	opts := &hclog.LoggerOptions{
+		Name:       "nomadd",
+		Level:      hclog.LevelFromString(level),
+		JSONFormat: logJSON,
+	}
+	if file != nil {
+		opts.Output = file
+	} else {
+		opts.Output = os.Stdout
+	}
+
+	return &service{logger: hclog.New(opts), file: file}, nil
+}
+
+func (s *service) Debug(msg string, args ...interface{}) { s.logger.Debug(msg, args...) }
+func (s *service) Info(msg string, args ...interface{})  { s.logger.Info(msg, args...) }
+func (s *service) Warn(msg string, args ...interface{})  { s.logger.Warn(msg, args...) }
+func (s *service) Error(msg string, args ...interface{}) { s.logger.Error(msg, args...) }
+
+func (s *service) Fatal(msg string, args ...interface{}) {
+	s.logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+func (s *service) With(args ...interface{}) Service {
+	return &service{logger: s.logger.With(args...), file: s.file}
+}
+
+func (s *service) Named(name string) Service {
+	return &service{logger: s.logger.Named(name), file: s.file}
+}
+
+func (s *service) SetLevel(level string) {
+	s.logger.SetLevel(hclog.LevelFromString(level))
+}
+
+func (s *service) Reopen() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Rotate()
+}
+
+func (s *service) Hclog() hclog.Logger {
+	return s.logger
+}
+
+func intOrDefault(v *int, def int) int {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func boolOrDefault(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
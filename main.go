@@ -1,22 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
 	"github.com/gorilla/mux"
+	"github.com/hashicorp/faas-nomad/config"
 	"github.com/hashicorp/faas-nomad/consul"
 	"github.com/hashicorp/faas-nomad/handlers"
+	"github.com/hashicorp/faas-nomad/logging"
 	"github.com/hashicorp/faas-nomad/metrics"
 	"github.com/hashicorp/faas-nomad/nomad"
+	"github.com/hashicorp/faas-nomad/tracing"
 	fntypes "github.com/hashicorp/faas-nomad/types"
-	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/api"
 	bootstrap "github.com/openfaas/faas-provider"
 	"github.com/openfaas/faas-provider/types"
@@ -39,6 +43,11 @@ var (
 	vaultSecretPathPrefix = flag.String("vault_secret_path_prefix", "secret/openfaas", "The Vault k/v path prefix used when secrets are deployed with a function")
 )
 
+var (
+	metricsPrometheusEnabled = flag.Bool("metrics.prometheus_enabled", false, "Enable a Prometheus sink and expose /metrics for the OpenFaaS autoscaler to scrape directly")
+	metricsPrometheusBind    = flag.String("metrics.prometheus_bind", ":8081", "Bind address for the Prometheus /metrics endpoint")
+)
+
 var functionTimeout = flag.Duration("function_timeout", 30*time.Second, "Timeout for function execution")
 
 var (
@@ -47,6 +56,16 @@ var (
 	loggerOutput = flag.String("logger_output", "", "Filepath to write log file, if omitted stdOut is used")
 )
 
+var configPath = flag.String("config", "", "Path to an HCL or JSON config file, values here are overridden by CLI flags")
+
+var adminBind = flag.String("admin_bind", ":8082", "Bind address for the basic-auth protected admin endpoints, e.g. PUT /system/logger")
+
+// visitedFlags is populated once flags are parsed and is used to build the
+// CLI layer passed to config.ReadConfig: only flags the operator actually
+// set, on the command line or through a deprecated environment variable,
+// should be able to override the config file.
+var visitedFlags = map[string]bool{}
+
 // parseDeprecatedEnvironment is used to merge the previous environment variable configuration to the new flag style
 // this will be removed in the next release
 func parseDeprecatedEnvironment() {
@@ -118,127 +137,304 @@ func checkDeprecatedLoggerOutput() {
 
 func main() {
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) { visitedFlags[f.Name] = true })
 	parseDeprecatedEnvironment() // to be removed in 0.3.0
+	// A deprecated environment variable overwrites its flag's value, so
+	// that flag counts as set for flagsToConfig.
+	for env, name := range map[string]string{
+		"STATSD_ADDR":     "statsd_addr",
+		"NOMAD_ADDR_http": "node_addr",
+		"NOMAD_ADDR":      "nomad_addr",
+		"CONSUL_ADDR":     "consul_addr",
+		"NOMAD_REGION":    "nomad_region",
+		"logger_level":    "logger_level",
+		"logger_format":   "logger_format",
+		"logger_output":   "logger_output",
+	} {
+		if os.Getenv(env) != "" {
+			visitedFlags[name] = true
+		}
+	}
 
-	logger, stats, nomadClient, consulResolver := makeDependencies(
-		*statsdServer,
-		*nodeURI,
-		*nomadAddr,
-		*consulAddr,
-		*consulACL,
-		*nomadRegion,
+	cfg, err := config.ReadConfig(*configPath, flagsToConfig())
+	if err != nil {
+		log.Fatalf("Unable to read config: %s", err.Error())
+	}
+	liveConfig := config.NewLive(cfg)
+
+	shutdownTracing, err := tracing.Init(cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Unable to initialize tracing: %s", err.Error())
+	}
+	defer shutdownTracing(context.Background())
+
+	logger, stats, promMux, nomadClient, consulResolver := makeDependencies(
+		cfg,
+		*cfg.NodeAddr,
+		*cfg.NomadAddr,
+		*cfg.ConsulAddr,
+		*cfg.ConsulACL,
+		*cfg.NomadRegion,
 	)
 
+	if promMux != nil {
+		go func() {
+			logger.Info("Serving Prometheus metrics", "addr", cfg.Metrics.PrometheusBind)
+			if err := http.ListenAndServe(cfg.Metrics.PrometheusBind, promMux); err != nil {
+				logger.Error("Prometheus metrics server exited", "error", err)
+			}
+		}()
+	}
+
 	logger.Info("Started version: " + version)
 	stats.Incr("started", nil, 1)
 
-	handlers := createFaaSHandlers(nomadClient, consulResolver, stats, logger)
+	watchForReload(liveConfig, logger, consulResolver)
+	watchForReopen(logger)
+	serveAdmin(liveConfig, logger)
 
-	config := &types.FaaSConfig{}
-	config.ReadTimeout = *functionTimeout
-	config.WriteTimeout = *functionTimeout
-	config.TCPPort = port
-	config.EnableHealth = true
-	config.EnableBasicAuth = *enableBasicAuth
-	config.SecretMountPath = *basicAuthSecretPath
+	faasHandlers := createFaaSHandlers(nomadClient, consulResolver, stats, logger, liveConfig)
 
-	logger.Info("Started Nomad provider", "port", *config.TCPPort)
-	logger.Info("Basic authentication", "enabled", fmt.Sprintf("%t", config.EnableBasicAuth))
+	faasConfig := &types.FaaSConfig{}
+	faasConfig.ReadTimeout = cfg.FunctionTimeoutDuration()
+	faasConfig.WriteTimeout = cfg.FunctionTimeoutDuration()
+	faasConfig.TCPPort = cfg.Port
+	faasConfig.EnableHealth = true
+	faasConfig.EnableBasicAuth = *cfg.EnableBasicAuth
+	faasConfig.SecretMountPath = *cfg.BasicAuthSecretPath
 
-	bootstrap.Serve(handlers, config)
+	logger.Info("Started Nomad provider", "port", *faasConfig.TCPPort)
+	logger.Info("Basic authentication", "enabled", fmt.Sprintf("%t", faasConfig.EnableBasicAuth))
+
+	bootstrap.Serve(faasHandlers, faasConfig)
 }
 
-func createFaaSHandlers(nomadClient *api.Client, consulResolver *consul.Resolver, stats *statsd.Client, logger hclog.Logger) *types.FaaSHandlers {
+// flagsToConfig captures the values set on the CLI as a *config.Config
+// layer. Only flags the operator actually passed are populated so that
+// unset flags fall through to the config file rather than clobbering it
+// with their zero-value defaults.
+func flagsToConfig() *config.Config {
+	c := &config.Config{}
+
+	if visitedFlags["port"] {
+		c.Port = port
+	}
+	if visitedFlags["node_addr"] {
+		c.NodeAddr = nodeURI
+	}
+	if visitedFlags["nomad_addr"] {
+		c.NomadAddr = nomadAddr
+	}
+	if visitedFlags["nomad_region"] {
+		c.NomadRegion = nomadRegion
+	}
+	if visitedFlags["consul_addr"] {
+		c.ConsulAddr = consulAddr
+	}
+	if visitedFlags["consul_acl"] {
+		c.ConsulACL = consulACL
+	}
+	if visitedFlags["enable_consul_dns"] {
+		c.EnableConsulDNS = enableConsulDNS
+	}
+	if visitedFlags["enable_basic_auth"] {
+		c.EnableBasicAuth = enableBasicAuth
+	}
+	if visitedFlags["basic_auth_secret_path"] {
+		c.BasicAuthSecretPath = basicAuthSecretPath
+	}
+	if visitedFlags["vault_default_policy"] {
+		c.VaultDefaultPolicy = vaultDefaultPolicy
+	}
+	if visitedFlags["vault_secret_path_prefix"] {
+		c.VaultSecretPathPrefix = vaultSecretPathPrefix
+	}
+	if visitedFlags["function_timeout"] {
+		s := functionTimeout.String()
+		c.FunctionTimeout = &s
+	}
+	if visitedFlags["logger_format"] {
+		c.LoggerFormat = loggerFormat
+	}
+	if visitedFlags["logger_level"] {
+		c.LoggerLevel = loggerLevel
+	}
+	if visitedFlags["logger_output"] {
+		c.LoggerOutput = loggerOutput
+	}
+	if visitedFlags["statsd_addr"] || visitedFlags["metrics.prometheus_enabled"] || visitedFlags["metrics.prometheus_bind"] {
+		c.Metrics = &config.MetricsConfig{}
+		if visitedFlags["statsd_addr"] {
+			c.Metrics.StatsDAddr = *statsdServer
+		}
+		if visitedFlags["metrics.prometheus_enabled"] {
+			c.Metrics.PrometheusEnabled = *metricsPrometheusEnabled
+		}
+		if visitedFlags["metrics.prometheus_bind"] {
+			c.Metrics.PrometheusBind = *metricsPrometheusBind
+		}
+	}
+
+	return c
+}
+
+// watchForReload installs a SIGHUP handler that re-reads the config file
+// named by -config and pushes the parts of it that can change without a
+// restart into the running provider: log level, function timeout, and
+// the Consul ACL token used by the resolver.
+func watchForReload(liveConfig *config.Live, logger logging.Service, consulResolver *consul.Resolver) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for range sigs {
+			logger.Info("Received SIGHUP, reloading config", "path", *configPath)
+
+			cfg, err := config.ReadConfig(*configPath, flagsToConfig())
+			if err != nil {
+				logger.Error("Unable to reload config, keeping previous values", "error", err)
+				continue
+			}
+			liveConfig.Set(cfg)
+
+			logger.SetLevel(*cfg.LoggerLevel)
+			consulResolver.SetACLToken(*cfg.ConsulACL)
+
+			logger.Info("Config reloaded", "logger_level", *cfg.LoggerLevel, "function_timeout", *cfg.FunctionTimeout)
+		}
+	}()
+}
+
+// watchForReopen installs a SIGUSR1 handler that closes and reopens the
+// log file, recovering from an external logrotate-style rename that
+// would otherwise leave the provider writing to a deleted inode.
+func watchForReopen(logger logging.Service) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+
+	go func() {
+		for range sigs {
+			if err := logger.Reopen(); err != nil {
+				logger.Error("Unable to reopen log file", "error", err)
+				continue
+			}
+			logger.Info("Reopened log file")
+		}
+	}()
+}
+
+// serveAdmin starts the basic-auth protected admin mux in the
+// background. Today it only exposes PUT /system/logger, but it is the
+// natural home for future runtime-tunable endpoints.
+func serveAdmin(liveConfig *config.Live, logger logging.Service) {
+	mux := http.NewServeMux()
+	mux.Handle("/system/logger", handlers.BasicAuth(
+		func() string { return *liveConfig.Get().BasicAuthSecretPath },
+		handlers.MakeAdminLoggerHandler(logger),
+	))
+
+	go func() {
+		logger.Info("Serving admin endpoints", "addr", *adminBind)
+		if err := http.ListenAndServe(*adminBind, mux); err != nil {
+			logger.Error("Admin server exited", "error", err)
+		}
+	}()
+}
+
+func createFaaSHandlers(nomadClient *api.Client, consulResolver *consul.Resolver, stats metrics.StatsD, logger logging.Service, liveConfig *config.Live) *types.FaaSHandlers {
+	cfg := liveConfig.Get()
 
 	datacenter, err := nomadClient.Agent().Datacenter()
 	if err != nil {
-		logger.Error("Error returning the agent's datacenter", err)
+		logger.Error("Error returning the agent's datacenter", "error", err)
 		datacenter = "dc1"
 	}
 	logger.Info("Datacenter from agent: " + datacenter)
 
 	providerConfig := &fntypes.ProviderConfig{
-		VaultDefaultPolicy:    *vaultDefaultPolicy,
-		VaultSecretPathPrefix: *vaultSecretPathPrefix,
+		VaultDefaultPolicy:    *cfg.VaultDefaultPolicy,
+		VaultSecretPathPrefix: *cfg.VaultSecretPathPrefix,
 		Datacenter:            datacenter,
-		ConsulAddress:         *consulAddr,
-		ConsulDNSEnabled:      *enableConsulDNS,
+		ConsulAddress:         *cfg.ConsulAddr,
+		ConsulDNSEnabled:      *cfg.EnableConsulDNS,
 	}
 
 	return &types.FaaSHandlers{
-		FunctionReader: handlers.MakeReader(nomadClient.Jobs(), logger, stats),
-		DeployHandler:  handlers.MakeDeploy(nomadClient.Jobs(), *providerConfig, logger, stats),
-		DeleteHandler:  handlers.MakeDelete(consulResolver, nomadClient.Jobs(), logger, stats),
-		ReplicaReader:  makeReplicationReader(nomadClient.Jobs(), logger, stats),
-		ReplicaUpdater: makeReplicationUpdater(nomadClient.Jobs(), logger, stats),
-		FunctionProxy:  makeFunctionProxyHandler(consulResolver, logger, stats, *functionTimeout),
-		UpdateHandler:  handlers.MakeDeploy(nomadClient.Jobs(), *providerConfig, logger, stats),
-		InfoHandler:    handlers.MakeInfo(logger, stats, version),
+		FunctionReader: guard("function_reader", logger, stats, liveConfig, handlers.MakeReader(nomadClient.Jobs(), logger, stats)),
+		DeployHandler:  guard("deploy", logger, stats, liveConfig, handlers.MakeDeploy(nomadClient.Jobs(), *providerConfig, logger, stats)),
+		DeleteHandler:  guard("delete", logger, stats, liveConfig, handlers.MakeDelete(consulResolver, nomadClient.Jobs(), logger, stats)),
+		ReplicaReader:  guard("replica_reader", logger, stats, liveConfig, makeReplicationReader(nomadClient.Jobs(), logger, stats)),
+		ReplicaUpdater: guard("replica_updater", logger, stats, liveConfig, makeReplicationUpdater(nomadClient.Jobs(), logger, stats)),
+		FunctionProxy:  guardStreaming("function_proxy", logger, stats, liveConfig, makeFunctionProxyHandler(consulResolver, logger, stats, liveConfig)),
+		UpdateHandler:  guard("update", logger, stats, liveConfig, handlers.MakeDeploy(nomadClient.Jobs(), *providerConfig, logger, stats)),
+		InfoHandler:    guard("info", logger, stats, liveConfig, handlers.MakeInfo(logger, stats, version)),
 		Health:         handlers.MakeHealthHandler(),
 	}
 }
 
-func makeDependencies(statsDAddr, thisAddr, nomadAddr, consulAddr, consulACL, region string) (hclog.Logger, *statsd.Client, *api.Client, *consul.Resolver) {
-	logger := setupLogging()
+// guard wraps a handler with the panic-recovery and request-timeout
+// middleware so every entry in types.FaaSHandlers (bar the health check,
+// which must never block, and the function proxy, which uses
+// guardStreaming) is protected from a hung or panicking downstream call
+// to Nomad or Consul. The timeout is read from liveConfig on every
+// request, so a SIGHUP-driven change to function_timeout takes effect
+// without a restart. The server's read and write timeouts keep the
+// value read at startup, so a reload can shorten the effective timeout
+// but not lengthen it past that value.
+func guard(name string, logger logging.Service, stats metrics.StatsD, liveConfig *config.Live, next http.HandlerFunc) http.HandlerFunc {
+	wrapped := handlers.Recover(name, logger.Hclog(), stats, handlers.DynamicTimeout(liveConfig.FunctionTimeoutDuration, "function call timed out", next))
+	return wrapped.ServeHTTP
+}
+
+// guardStreaming is guard for the function proxy: http.TimeoutHandler
+// buffers the whole response to arbitrate the handler-vs-timeout race,
+// which breaks streamed or large function output, so the proxy is
+// bounded with a context deadline instead (handlers.ContextDeadline),
+// enforced concretely by the per-call http.Client.Timeout that
+// makeFunctionProxyHandler already sets on the outbound client.
+func guardStreaming(name string, logger logging.Service, stats metrics.StatsD, liveConfig *config.Live, next http.HandlerFunc) http.HandlerFunc {
+	wrapped := handlers.Recover(name, logger.Hclog(), stats, handlers.ContextDeadline(liveConfig.FunctionTimeoutDuration, next))
+	return wrapped.ServeHTTP
+}
 
-	logger.Info("Using StatsD server:" + statsDAddr)
-	stats, err := statsd.New(statsDAddr)
+func makeDependencies(cfg *config.Config, thisAddr, nomadAddr, consulAddr, consulACL, region string) (logging.Service, metrics.StatsD, *http.ServeMux, *api.Client, *consul.Resolver) {
+	logger, err := logging.New(cfg)
 	if err != nil {
-		logger.Error("Error creating statsd client", err)
+		log.Fatalf("Unable to create logger: %s", err.Error())
 	}
 
-	// prefix every metric with the app name
-	stats.Namespace = "faas.nomadd."
-	stats.Tags = append(stats.Tags, "instance:"+strings.Replace(thisAddr, ":", "_", -1))
+	instanceTag := "instance:" + strings.Replace(thisAddr, ":", "_", -1)
+
+	logger.Info("Creating metrics client", "statsd_addr", cfg.Metrics.StatsDAddr, "prometheus_enabled", cfg.Metrics.PrometheusEnabled)
+	stats, promMux, err := metrics.New(cfg.Metrics, "faas.nomadd", []string{instanceTag})
+	if err != nil {
+		logger.Error("Error creating metrics client", "error", err)
+	}
 
 	c := api.DefaultConfig()
 	logger.Info("create nomad client", "addr", nomadAddr)
 	nomadClient, err := api.NewClient(c.ClientConfig(region, nomadAddr, false))
 	if err != nil {
-		logger.Error("Unable to create nomad client", err)
+		logger.Error("Unable to create nomad client", "error", err)
 	}
 
 	cr := consul.NewResolver(consulAddr, consulACL, logger.Named("consul_resolver"))
 
-	return logger, stats, nomadClient, cr
-}
-
-func setupLogging() hclog.Logger {
-	logJSON := false
-	if *loggerFormat == "json" {
-		logJSON = true
-	}
-
-	appLogger := hclog.New(&hclog.LoggerOptions{
-		Name:       "nomadd",
-		Level:      hclog.LevelFromString(*loggerLevel),
-		JSONFormat: logJSON,
-		Output:     createLogFile(),
-	})
-
-	return appLogger
+	return logger, stats, promMux, nomadClient, cr
 }
 
-func createLogFile() *os.File {
-	if logFile := os.Getenv("logger_output"); logFile != "" {
-		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-		if err == nil {
-			return f
-		}
-
-		log.Printf("Unable to open file for output, defaulting to std out: %s\n", err.Error())
-	}
+func makeFunctionProxyHandler(r consul.ServiceResolver, logger logging.Service, s metrics.StatsD, liveConfig *config.Live) http.HandlerFunc {
+	timeout := liveConfig.FunctionTimeoutDuration()
+	client := handlers.MakeProxyClient(timeout, logger)
+	client.Transport = tracing.WrapTransport(client.Transport)
 
-	return os.Stdout
-}
-func makeFunctionProxyHandler(r consul.ServiceResolver, logger hclog.Logger, s *statsd.Client, timeout time.Duration) http.HandlerFunc {
-	return handlers.MakeExtractFunctionMiddleWare(
+	proxy := handlers.MakeExtractFunctionMiddleWare(
 		func(r *http.Request) map[string]string {
 			return mux.Vars(r)
 		},
 		handlers.MakeProxy(
 			handlers.ProxyConfig{
-				Client:   handlers.MakeProxyClient(timeout, logger),
+				Client:   client,
 				Resolver: r,
 				Logger:   logger,
 				StatsD:   s,
@@ -246,9 +442,16 @@ func makeFunctionProxyHandler(r consul.ServiceResolver, logger hclog.Logger, s *
 			},
 		),
 	)
+
+	traced := handlers.TraceFunctionInvoke(
+		func(r *http.Request) string { return mux.Vars(r)["name"] },
+		proxy,
+	)
+
+	return traced.ServeHTTP
 }
 
-func makeReplicationReader(client nomad.Job, logger hclog.Logger, stats metrics.StatsD) http.HandlerFunc {
+func makeReplicationReader(client nomad.Job, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
 	return handlers.MakeExtractFunctionMiddleWare(
 		func(r *http.Request) map[string]string {
 			return mux.Vars(r)
@@ -257,7 +460,7 @@ func makeReplicationReader(client nomad.Job, logger hclog.Logger, stats metrics.
 	)
 }
 
-func makeReplicationUpdater(client nomad.Job, logger hclog.Logger, stats metrics.StatsD) http.HandlerFunc {
+func makeReplicationUpdater(client nomad.Job, logger logging.Service, stats metrics.StatsD) http.HandlerFunc {
 	return handlers.MakeExtractFunctionMiddleWare(
 		func(r *http.Request) map[string]string {
 			return mux.Vars(r)
@@ -0,0 +1,149 @@
+// Package metrics provides a sink-agnostic interface for provider
+// telemetry. The interface mirrors the subset of *statsd.Client that
+// faas-nomad already depended on, but is now backed by
+// github.com/armon/go-metrics so it can fan out to any combination of
+// statsd, dogstatsd, Prometheus and Circonus, with an in-memory sink
+// used when none of those is configured.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/armon/go-metrics/circonus"
+	"github.com/armon/go-metrics/datadog"
+	"github.com/armon/go-metrics/prometheus"
+	"github.com/hashicorp/faas-nomad/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// StatsD is the interface every handler depends on for emitting
+// metrics. The name is kept from the original Datadog-backed
+// implementation so call sites did not need to change, even though the
+// implementation underneath is no longer StatsD-specific.
+type StatsD interface {
+	Incr(name string, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+	Histogram(name string, value float64, tags []string, rate float64) error
+}
+
+// sink adapts the go-metrics fanout sink to the StatsD interface,
+// translating the `key:value` tag strings used throughout the handlers
+// into gometrics.Label values.
+type sink struct {
+	m        *gometrics.Metrics
+	baseTags []string
+}
+
+// New builds a StatsD implementation from the provided metrics config.
+// Every sink named in cfg is created and combined with a
+// gometrics.FanoutSink so a single call fans out to all of them.
+// serviceName prefixes every metric, matching the "faas.nomadd."
+// namespace used previously.
+func New(cfg *config.MetricsConfig, serviceName string, baseTags []string) (StatsD, *http.ServeMux, error) {
+	if cfg == nil {
+		cfg = &config.MetricsConfig{StatsDAddr: "localhost:8125"}
+	}
+
+	var sinks gometrics.FanoutSink
+	var promMux *http.ServeMux
+
+	if cfg.StatsDAddr != "" {
+		s, err := gometrics.NewStatsdSink(cfg.StatsDAddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to create statsd sink: %s", err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	if cfg.PrometheusEnabled {
+		promSink, err := prometheus.NewPrometheusSink()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to create prometheus sink: %s", err)
+		}
+		sinks = append(sinks, promSink)
+
+		// promSink registers each metric it sees with the default
+		// Prometheus registerer as it is recorded, so scraping just
+		// means serving the default gatherer over HTTP.
+		promMux = http.NewServeMux()
+		promMux.Handle("/metrics", promhttp.Handler())
+	}
+
+	if cfg.DogStatsDAddr != "" {
+		s, err := datadog.NewDogStatsdSink(cfg.DogStatsDAddr, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to create dogstatsd sink: %s", err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	if cfg.CirconusAPIToken != "" {
+		circConfig := &circonus.Config{}
+		circConfig.CheckManager.API.TokenKey = cfg.CirconusAPIToken
+		circConfig.CheckManager.API.TokenApp = cfg.CirconusAPIApp
+
+		circSink, err := circonus.NewCirconusSink(circConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to create circonus sink: %s", err)
+		}
+		sinks = append(sinks, circSink)
+	}
+
+	if len(sinks) == 0 {
+		sinks = append(sinks, gometrics.NewInmemSink(10*time.Second, time.Minute))
+	}
+
+	conf := gometrics.DefaultConfig(serviceName)
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+
+	m, err := gometrics.New(conf, sinks)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create metrics client: %s", err)
+	}
+
+	return &sink{m: m, baseTags: baseTags}, promMux, nil
+}
+
+func (s *sink) Incr(name string, tags []string, rate float64) error {
+	s.m.IncrCounterWithLabels([]string{name}, 1, toLabels(append(s.baseTags, tags...)))
+	return nil
+}
+
+func (s *sink) Gauge(name string, value float64, tags []string, rate float64) error {
+	s.m.SetGaugeWithLabels([]string{name}, float32(value), toLabels(append(s.baseTags, tags...)))
+	return nil
+}
+
+func (s *sink) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	s.m.AddSampleWithLabels([]string{name}, float32(value.Milliseconds()), toLabels(append(s.baseTags, tags...)))
+	return nil
+}
+
+func (s *sink) Histogram(name string, value float64, tags []string, rate float64) error {
+	s.m.AddSampleWithLabels([]string{name}, float32(value), toLabels(append(s.baseTags, tags...)))
+	return nil
+}
+
+// toLabels converts the "key:value" tag strings used throughout the
+// handlers (e.g. "instance:10_0_0_1", "function_name:hello") into
+// gometrics.Label values understood by every sink, including the ones
+// that don't support tagging natively.
+func toLabels(tags []string) []gometrics.Label {
+	labels := make([]gometrics.Label, 0, len(tags))
+	for _, t := range tags {
+		name, value := t, ""
+		for i := 0; i < len(t); i++ {
+			if t[i] == ':' {
+				name, value = t[:i], t[i+1:]
+				break
+			}
+		}
+		labels = append(labels, gometrics.Label{Name: name, Value: value})
+	}
+	return labels
+}
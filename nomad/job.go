@@ -0,0 +1,15 @@
+// Package nomad narrows the hashicorp/nomad/api surface down to the
+// handful of Jobs methods the provider actually calls, so handlers can
+// be tested against a fake without pulling in the full Nomad client.
+package nomad
+
+import "github.com/hashicorp/nomad/api"
+
+// Job is satisfied by *api.Jobs.
+type Job interface {
+	Register(job *api.Job, q *api.WriteOptions) (*api.JobRegisterResponse, *api.WriteMeta, error)
+	Deregister(jobID string, purge bool, q *api.WriteOptions) (string, *api.WriteMeta, error)
+	Info(jobID string, q *api.QueryOptions) (*api.Job, *api.QueryMeta, error)
+	List(q *api.QueryOptions) ([]*api.JobListStub, *api.QueryMeta, error)
+	Allocations(jobID string, allAllocs bool, q *api.QueryOptions) ([]*api.AllocationListStub, *api.QueryMeta, error)
+}
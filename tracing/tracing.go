@@ -0,0 +1,110 @@
+// Package tracing wires up OpenTelemetry distributed tracing for the
+// provider: an OTLP exporter, a W3C traceparent-aware propagator, and
+// small helpers the handlers package uses to start spans around the
+// function proxy, Nomad, and Consul calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/faas-nomad/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this provider's spans in the tracing backend.
+const ServiceName = "faas-nomadd"
+
+// Init configures the global tracer provider and W3C propagator from
+// cfg. It returns a shutdown function the caller should defer to flush
+// and close the exporter on process exit. If cfg is nil or tracing is
+// disabled, Init installs a no-op provider and a shutdown that is safe
+// to call unconditionally.
+func Init(cfg *config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if cfg == nil || !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptrace.New(context.Background(), otlptracegrpc.NewClient(
+		otlptracegrpc.WithEndpoint(cfg.Endpoint),
+		otlptracegrpc.WithInsecure(),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP exporter: %s", err)
+	}
+
+	res, err := resource.New(context.Background(), resource.WithAttributes(
+		semconv.ServiceNameKey.String(ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace resource: %s", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1.0
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the named tracer from the global provider installed by
+// Init. Call sites use a short, dotted name (e.g. "handlers.proxy").
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// NoteResolved attaches resolver.endpoint and function.replicas
+// attributes to the span found in ctx once the Consul resolver has
+// found a healthy instance. Callers pass the context captured before
+// starting their own child span (e.g. "consul.resolve"), so the
+// attributes land on the enclosing "faas.invoke" span as the request
+// that asked for tracing expects.
+func NoteResolved(ctx context.Context, endpoint string, replicas int) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("resolver.endpoint", endpoint),
+		attribute.Int("function.replicas", replicas),
+	)
+}
+
+// NoteColdStart records a "cold_start" event on the span found in ctx,
+// used by the Consul resolver when a function has no healthy instances
+// yet and Resolve is blocking on scale-up, so a slow cold start is
+// visible in the trace without needing debug-level logs.
+func NoteColdStart(ctx context.Context, functionName string) {
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("cold_start", trace.WithAttributes(
+		attribute.String("function.name", functionName),
+	))
+}
+
+// WrapTransport instruments an outbound http.RoundTripper with
+// otelhttp so every call the proxy makes to a function carries the
+// current span as a W3C traceparent header and is recorded as a child
+// span of "faas.invoke".
+func WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(rt)
+}